@@ -0,0 +1,190 @@
+package wasm
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sync"
+
+	wasm "github.com/wasmerio/go-ext-wasm/wasmer"
+)
+
+var crc32Table = crc32.MakeTable(crc32.IEEE)
+
+// cacheKey identifies bytecode by its full sha256 digest, not a 32-bit CRC32: CRC32 is linear and
+// collisions are trivial to construct deliberately, which would let one script's compiled module be
+// served back for a different script's bytecode. CRC32 is still used (via checksum/artifactPath) purely
+// to shard on-disk artifacts, never to decide a cache hit.
+type cacheKey [sha256.Size]byte
+
+func keyFor(code []byte) cacheKey {
+	return sha256.Sum256(code)
+}
+
+// compiledEntry is a single cache slot: the compiled module plus the bytecode size, which is all the LRU
+// eviction needs to track.
+type compiledEntry struct {
+	size   int
+	module wasm.Module
+}
+
+// ModuleCache compiles wasm bytecode once and reuses the result for every later call with the same code,
+// so that an oracle script executed thousands of times per block is only ever compiled once.
+type ModuleCache struct {
+	maxBytes int64
+	diskDir  string // optional; empty disables the crash-safe disk tier
+
+	entries sync.Map // cacheKey -> *compiledEntry, the concurrent-safe hot path
+
+	mu   sync.Mutex // guards lru/size, which GetOrCompile only touches on insert/evict
+	lru  []cacheKey
+	size int64
+}
+
+// NewModuleCache returns a cache that evicts least-recently-used modules once the total bytecode size of
+// its entries exceeds maxSizeBytes.
+func NewModuleCache(maxSizeBytes int64) *ModuleCache {
+	return &ModuleCache{maxBytes: maxSizeBytes}
+}
+
+// SetDiskDir enables the crash-safe disk tier: a miss in the in-memory cache first checks dir for a
+// previously saved artifact before recompiling, and a fresh compile is saved back to dir.
+func (c *ModuleCache) SetDiskDir(dir string) {
+	c.diskDir = dir
+}
+
+// defaultCache backs the package-level entry points; callers who need a different eviction policy or disk
+// tier can build their own ModuleCache and call GetOrCompile directly.
+var defaultCache = NewModuleCache(256 << 20)
+
+func checksum(code []byte) uint32 {
+	return crc32.Update(0, crc32Table, code)
+}
+
+// GetOrCompile returns the compiled module for code, compiling and caching it on first use. On a miss, it
+// consults the disk tier (if enabled) before falling back to a full compile.
+func (c *ModuleCache) GetOrCompile(code []byte) (wasm.Module, error) {
+	key := keyFor(code)
+	if v, ok := c.entries.Load(key); ok {
+		entry := v.(*compiledEntry)
+		c.touch(key)
+		return entry.module, nil
+	}
+
+	module, err := c.loadOrCompile(code)
+	if err != nil {
+		return wasm.Module{}, err
+	}
+
+	c.entries.Store(key, &compiledEntry{size: len(code), module: module})
+	c.touch(key)
+	c.evictIfNeeded(int64(len(code)))
+	return module, nil
+}
+
+func (c *ModuleCache) loadOrCompile(code []byte) (wasm.Module, error) {
+	if c.diskDir != "" {
+		if serialized, err := LoadArtifact(c.diskDir, code); err == nil {
+			if module, err := wasm.DeserializeModule(serialized); err == nil {
+				return module, nil
+			}
+		}
+	}
+
+	module, err := wasm.Compile(code)
+	if err != nil {
+		return wasm.Module{}, err
+	}
+
+	if c.diskDir != "" {
+		if serialized, err := module.Serialize(); err == nil {
+			_ = SaveArtifact(c.diskDir, code, serialized)
+		}
+	}
+	return module, nil
+}
+
+func (c *ModuleCache) touch(key cacheKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, k := range c.lru {
+		if k == key {
+			c.lru = append(c.lru[:i], c.lru[i+1:]...)
+			break
+		}
+	}
+	c.lru = append(c.lru, key)
+}
+
+func (c *ModuleCache) evictIfNeeded(added int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size += added
+	for c.size > c.maxBytes && len(c.lru) > 0 {
+		oldest := c.lru[0]
+		c.lru = c.lru[1:]
+		v, ok := c.entries.Load(oldest)
+		if !ok {
+			continue
+		}
+		c.entries.Delete(oldest)
+		c.size -= int64(v.(*compiledEntry).size)
+	}
+}
+
+// artifactPath returns the content-addressed path a compiled artifact for code is stored at: the CRC32
+// picks the shard directory and the sha256 names the file, mirroring etcd's WAL record layout of a
+// checksum guarding each entry. The sha256 is what makes the path unique; the CRC32 is only a cheap
+// sharding prefix.
+func artifactPath(dir string, code []byte) string {
+	sum := sha256.Sum256(code)
+	return filepath.Join(dir, fmt.Sprintf("%08x", checksum(code)), fmt.Sprintf("%x.bin", sum))
+}
+
+// SaveArtifact persists a serialized compiled module to dir under a content-addressed path, appending a
+// 4-byte CRC32 trailer so a half-written file left behind by a crashed process is detected and discarded
+// the next time it is loaded instead of being deserialized.
+func SaveArtifact(dir string, code []byte, serialized []byte) error {
+	path := artifactPath(dir, code)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	trailer := make([]byte, 4)
+	binary.LittleEndian.PutUint32(trailer, crc32.Update(0, crc32Table, serialized))
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(serialized, trailer...), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadArtifact loads a serialized compiled module previously written by SaveArtifact, rejecting it if the
+// CRC32 trailer doesn't match the stored bytes.
+func LoadArtifact(dir string, code []byte) ([]byte, error) {
+	raw, err := os.ReadFile(artifactPath(dir, code))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < 4 {
+		return nil, errors.New("LoadArtifact: truncated cache artifact")
+	}
+	data, trailer := raw[:len(raw)-4], raw[len(raw)-4:]
+	if binary.LittleEndian.Uint32(trailer) != crc32.Update(0, crc32Table, data) {
+		return nil, errors.New("LoadArtifact: cache artifact failed crc32 check")
+	}
+	return data, nil
+}
+
+func newInstance(code []byte) (wasm.Instance, error) {
+	module, err := defaultCache.GetOrCompile(code)
+	if err != nil {
+		return wasm.Instance{}, err
+	}
+	return module.Instantiate()
+}
@@ -0,0 +1,88 @@
+package wasm
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSaveLoadArtifactRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	code := []byte("fake bytecode")
+	serialized := []byte("fake compiled module bytes")
+
+	if err := SaveArtifact(dir, code, serialized); err != nil {
+		t.Fatalf("SaveArtifact: %v", err)
+	}
+
+	got, err := LoadArtifact(dir, code)
+	if err != nil {
+		t.Fatalf("LoadArtifact: %v", err)
+	}
+	if string(got) != string(serialized) {
+		t.Fatalf("LoadArtifact returned %q, want %q", got, serialized)
+	}
+}
+
+func TestLoadArtifactRejectsCorruption(t *testing.T) {
+	dir := t.TempDir()
+	code := []byte("fake bytecode")
+	if err := SaveArtifact(dir, code, []byte("original bytes")); err != nil {
+		t.Fatalf("SaveArtifact: %v", err)
+	}
+
+	path := artifactPath(dir, code)
+	if err := os.WriteFile(path, []byte("corrupted, trailer no longer matches"), 0o644); err != nil {
+		t.Fatalf("corrupting artifact: %v", err)
+	}
+
+	if _, err := LoadArtifact(dir, code); err == nil {
+		t.Fatal("LoadArtifact: expected an error for a corrupted artifact, got nil")
+	}
+}
+
+// TestCacheKeyIsFullDigest guards against regressing to a cache keyed by the 32-bit CRC32 alone: CRC32 is
+// linear, so a deliberate collision between two different scripts would otherwise alias one script's
+// compiled module onto another's lookup.
+func TestCacheKeyIsFullDigest(t *testing.T) {
+	a := []byte("oracle script A")
+	b := []byte("oracle script B")
+
+	if keyFor(a) == keyFor(b) {
+		t.Fatal("keyFor: expected different bytecode to produce different cache keys")
+	}
+
+	var zero cacheKey
+	if len(zero) <= 4 {
+		t.Fatalf("cacheKey is %d bytes wide, expected a full digest rather than a 32-bit checksum", len(zero))
+	}
+}
+
+// TestModuleCacheCompilesRealFixture runs real bytecode through GetOrCompile and Instantiate, the one
+// path the rest of this file's tests (checksum math, corruption detection) never touch: a module that
+// fails to parse or instantiate under the real wasmer runtime would pass every other test here.
+func TestModuleCacheCompilesRealFixture(t *testing.T) {
+	code := loadFixtureModule(t)
+	cache := NewModuleCache(1 << 20)
+
+	module, err := cache.GetOrCompile(code)
+	if err != nil {
+		t.Fatalf("GetOrCompile: %v", err)
+	}
+	instance, err := module.Instantiate()
+	if err != nil {
+		t.Fatalf("Instantiate: %v", err)
+	}
+	defer instance.Close()
+
+	if instance.Exports["__allocate"] == nil {
+		t.Fatal("instantiated fixture module is missing its __allocate export")
+	}
+
+	// A second GetOrCompile for identical bytecode must hit the cache rather than recompile.
+	if _, err := cache.GetOrCompile(code); err != nil {
+		t.Fatalf("GetOrCompile (cache hit): %v", err)
+	}
+	if _, loaded := cache.entries.Load(keyFor(code)); !loaded {
+		t.Fatal("GetOrCompile: expected the compiled module to be cached under its sha256 key")
+	}
+}
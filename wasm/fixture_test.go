@@ -0,0 +1,29 @@
+package wasm
+
+import (
+	"os"
+	"testing"
+)
+
+// loadFixtureModule returns the bytecode of testdata/fixture.wasm, a hand-assembled (no wat2wasm
+// toolchain is available to build this package, let alone this sandbox) minimal module used to exercise
+// the real wasmer compile/instantiate/call path instead of only the pure-Go logic around it. It exports:
+//
+//   - memory: 1 page (64 KiB)
+//   - __allocate(size i32) -> i32: a real bump allocator off a mutable global starting at offset 1024
+//   - __execute(params i64, inputs i64) -> i64: returns params unchanged, i.e. echoes back whatever
+//     storeParams wrote, since the packed (len<<32|ptr) encoding __execute receives for its first
+//     argument is exactly what parseOutput expects back
+//   - __prepare(params i64) -> i64: same, for the one-argument __prepare ABI
+//
+// It deliberately does not export __name, __params_info, __raw_data_info, __parse_params,
+// __parse_raw_data or __abi_version, so it is not a stand-in for a real oracle script — just enough
+// surface to drive GetOrCompile, Instantiate(WithImports), and the __execute/__prepare call path for real.
+func loadFixtureModule(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/fixture.wasm")
+	if err != nil {
+		t.Fatalf("loadFixtureModule: %v", err)
+	}
+	return data
+}
@@ -0,0 +1,296 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	wasm "github.com/wasmerio/go-ext-wasm/wasmer"
+)
+
+// GasExhaustedError is returned when a script consumes more gas than its RunOptions allowed. It is
+// deterministic: every node running the same script against the same gas limit sees it identically, so
+// callers may treat it the same as any other script-rejected error.
+type GasExhaustedError struct {
+	Limit uint64
+}
+
+func (e *GasExhaustedError) Error() string {
+	return fmt.Sprintf("wasm: out of gas (limit %d)", e.Limit)
+}
+
+// DeadlineExceededError is returned when a script runs past its wall-clock deadline. Unlike
+// GasExhaustedError this depends on the speed of the machine it ran on and must not be treated as a
+// consensus-relevant failure.
+type DeadlineExceededError struct {
+	Deadline time.Duration
+}
+
+func (e *DeadlineExceededError) Error() string {
+	return fmt.Sprintf("wasm: execution exceeded deadline (%s)", e.Deadline)
+}
+
+// RunOptions bounds the resources a single Execute or Prepare call may consume.
+type RunOptions struct {
+	GasLimit         uint64
+	MemoryLimitPages uint32
+	Deadline         time.Duration
+}
+
+// DefaultRunOptions is used by Execute and Prepare, which keep their original signatures for backward
+// compatibility.
+var DefaultRunOptions = RunOptions{
+	GasLimit:         10_000_000,
+	MemoryLimitPages: 100,
+	Deadline:         5 * time.Second,
+}
+
+// gasMeter charges gas for the bytes an invocation moves across the wasm boundary (params, inputs and
+// output). This is an I/O-size proxy, not a compute bound: it has no view into instructions executed
+// inside the module, so a compute-bound loop that never allocates or returns burns zero gas and is only
+// ever caught by the wall-clock deadline below. True instruction-level metering would need a
+// bytecode-rewriting pass (or wasmer middleware) that instruments every basic block with a gas_left
+// decrement; this binding doesn't expose either hook today, so that is future work, not this commit's
+// guarantee.
+//
+// NOT PRODUCTION-SAFE against a compute-bound script on its own: runWithDeadline's wall-clock timeout is
+// the only thing that catches an infinite loop here, and per its own doc comment, a timed-out call leaks
+// its goroutine and instance for the life of the process rather than failing cleanly. Callers that need to
+// survive a hostile or buggy script under sustained load should run scripts in a process (or cgroup) they
+// can hard-kill on deadline, not rely on this package's deadline alone.
+type gasMeter struct {
+	left  uint64
+	limit uint64
+}
+
+func newGasMeter(limit uint64) *gasMeter {
+	return &gasMeter{left: limit, limit: limit}
+}
+
+func (g *gasMeter) consume(amount uint64) error {
+	if g == nil {
+		return nil
+	}
+	if amount > g.left {
+		g.left = 0
+		return &GasExhaustedError{Limit: g.limit}
+	}
+	g.left -= amount
+	return nil
+}
+
+const gasPerByte = 1
+
+func capMemoryPages(instance wasm.Instance, limit uint32) error {
+	if limit == 0 {
+		return nil
+	}
+	if instance.Memory.Length() > wasm.Pages(limit) {
+		return fmt.Errorf("wasm: memory grew past the %d page limit", limit)
+	}
+	return nil
+}
+
+// safeCloser runs a close function exactly once. Without it, a timed-out call in runWithDeadline and the
+// abandoned goroutine still running fn would both try to close (or use) the same instance concurrently,
+// which go-ext-wasm doesn't document as safe.
+type safeCloser struct {
+	once sync.Once
+	fn   func()
+}
+
+func newSafeCloser(instance wasm.Instance) *safeCloser {
+	return &safeCloser{fn: instance.Close}
+}
+
+func (c *safeCloser) Close() {
+	c.once.Do(c.fn)
+}
+
+// runWithDeadline runs fn in its own goroutine and reports a DeadlineExceededError if it hasn't finished
+// by deadline. closer is only ever closed after fn has actually returned, whether that's before or after
+// the deadline fires, so a timed-out call never closes (or otherwise touches) the instance while fn's
+// goroutine might still be running it. Note this means a genuinely compute-bound infinite loop, which
+// never returns, leaks its goroutine and its instance for the life of the process — there is no
+// interrupt mechanism below this that can stop it short of that; see the gasMeter comment above.
+func runWithDeadline(closer *safeCloser, deadline time.Duration, fn func() ([]byte, error)) ([]byte, error) {
+	if deadline <= 0 {
+		defer closer.Close()
+		return fn()
+	}
+
+	type result struct {
+		out []byte
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		out, err := fn()
+		done <- result{out, err}
+		closer.Close()
+	}()
+
+	select {
+	case r := <-done:
+		return r.out, r.err
+	case <-time.After(deadline):
+		return nil, &DeadlineExceededError{Deadline: deadline}
+	}
+}
+
+// ExecuteWithOptions behaves like Execute but enforces a gas limit, a memory page cap and a wall-clock
+// deadline, so a malicious or buggy oracle script can no longer loop forever or allocate until OOM.
+func ExecuteWithOptions(code []byte, params []byte, inputs [][]byte, opts RunOptions) ([]byte, error) {
+	return ExecuteContext(context.Background(), code, params, inputs, opts)
+}
+
+// ExecuteContext is ExecuteWithOptions with a context.Context for cancellation and tracing.
+func ExecuteContext(ctx context.Context, code []byte, params []byte, inputs [][]byte, opts RunOptions) ([]byte, error) {
+	span, ctx := startSpan(ctx, "wasm.Execute", code)
+	span.SetTag("wasm.params_size", len(params))
+	defer span.Finish()
+
+	instance, err := newInstanceTraced(ctx, code)
+	if err != nil {
+		finish(span, err)
+		return nil, err
+	}
+	closer := newSafeCloser(instance)
+
+	meter := newGasMeter(opts.GasLimit)
+	out, err := runWithDeadline(closer, opts.Deadline, func() ([]byte, error) {
+		if err := meter.consume(uint64(len(params)) * gasPerByte); err != nil {
+			return nil, err
+		}
+		marshalSpan, _ := childSpan(ctx, "wasm.marshal")
+		paramsInput, err := storeParams(instance, params)
+		if err != nil {
+			finish(marshalSpan, err)
+			return nil, err
+		}
+
+		inputSize := 0
+		for _, each := range inputs {
+			inputSize += len(each)
+		}
+		if err := meter.consume(uint64(inputSize) * gasPerByte); err != nil {
+			finish(marshalSpan, err)
+			return nil, err
+		}
+		wasmInput, err := allocate(instance, inputs)
+		finish(marshalSpan, err)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := capMemoryPages(instance, opts.MemoryLimitPages); err != nil {
+			return nil, err
+		}
+
+		fn := instance.Exports["__execute"]
+		if fn == nil {
+			return nil, errors.New("__execute not implemented")
+		}
+		callSpan, _ := childSpan(ctx, "wasm.call.__execute")
+		ptr, err := fn(paramsInput, wasmInput)
+		finish(callSpan, err)
+		if err != nil {
+			return nil, err
+		}
+		// __execute is the one thing in this call that can actually grow memory, so the page cap set
+		// before the call only bounds what the script started with; re-check after it runs too.
+		if err := capMemoryPages(instance, opts.MemoryLimitPages); err != nil {
+			return nil, err
+		}
+
+		unmarshalSpan, _ := childSpan(ctx, "wasm.unmarshal")
+		out, err := parseOutput(instance, ptr.ToI64())
+		finish(unmarshalSpan, err)
+		if err != nil {
+			return nil, err
+		}
+		if err := meter.consume(uint64(len(out)) * gasPerByte); err != nil {
+			return nil, err
+		}
+		return out, nil
+	})
+
+	span.SetTag("wasm.gas_used", opts.GasLimit-meter.left)
+	if _, timedOut := err.(*DeadlineExceededError); !timedOut {
+		// On a timeout the abandoned goroutine may still be running fn against this same instance, so
+		// reading instance.Memory here would race with it; only safe once fn is known to have returned.
+		span.SetTag("wasm.memory_pages", uint32(instance.Memory.Length()))
+	}
+	finish(span, err)
+	return out, err
+}
+
+// PrepareWithOptions behaves like Prepare but enforces the same resource bounds as ExecuteWithOptions.
+func PrepareWithOptions(code []byte, params []byte, opts RunOptions) ([]byte, error) {
+	return PrepareContext(context.Background(), code, params, opts)
+}
+
+// PrepareContext is PrepareWithOptions with a context.Context for cancellation and tracing.
+func PrepareContext(ctx context.Context, code []byte, params []byte, opts RunOptions) ([]byte, error) {
+	span, ctx := startSpan(ctx, "wasm.Prepare", code)
+	span.SetTag("wasm.params_size", len(params))
+	defer span.Finish()
+
+	instance, err := newInstanceTraced(ctx, code)
+	if err != nil {
+		finish(span, err)
+		return nil, err
+	}
+	closer := newSafeCloser(instance)
+
+	meter := newGasMeter(opts.GasLimit)
+	out, err := runWithDeadline(closer, opts.Deadline, func() ([]byte, error) {
+		if err := meter.consume(uint64(len(params)) * gasPerByte); err != nil {
+			return nil, err
+		}
+		marshalSpan, _ := childSpan(ctx, "wasm.marshal")
+		paramsInput, err := storeParams(instance, params)
+		finish(marshalSpan, err)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := capMemoryPages(instance, opts.MemoryLimitPages); err != nil {
+			return nil, err
+		}
+
+		fn := instance.Exports["__prepare"]
+		if fn == nil {
+			return nil, errors.New("__prepare not implemented")
+		}
+		callSpan, _ := childSpan(ctx, "wasm.call.__prepare")
+		ptr, err := fn(paramsInput)
+		finish(callSpan, err)
+		if err != nil {
+			return nil, err
+		}
+		if err := capMemoryPages(instance, opts.MemoryLimitPages); err != nil {
+			return nil, err
+		}
+
+		unmarshalSpan, _ := childSpan(ctx, "wasm.unmarshal")
+		out, err := parseOutput(instance, ptr.ToI64())
+		finish(unmarshalSpan, err)
+		if err != nil {
+			return nil, err
+		}
+		if err := meter.consume(uint64(len(out)) * gasPerByte); err != nil {
+			return nil, err
+		}
+		return out, nil
+	})
+
+	span.SetTag("wasm.gas_used", opts.GasLimit-meter.left)
+	if _, timedOut := err.(*DeadlineExceededError); !timedOut {
+		span.SetTag("wasm.memory_pages", uint32(instance.Memory.Length()))
+	}
+	finish(span, err)
+	return out, err
+}
@@ -0,0 +1,101 @@
+package wasm
+
+import (
+	"bytes"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSafeCloserRunsOnce(t *testing.T) {
+	var calls int32
+	closer := &safeCloser{fn: func() { atomic.AddInt32(&calls, 1) }}
+
+	closer.Close()
+	closer.Close()
+	closer.Close()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("safeCloser.Close ran %d times, want exactly 1", got)
+	}
+}
+
+// TestRunWithDeadlineDoesNotCloseWhileFnIsRunning guards against the use-after-close/concurrent-close
+// race: on timeout, runWithDeadline must report DeadlineExceededError without touching the closer until
+// the abandoned goroutine's fn has actually returned.
+func TestRunWithDeadlineDoesNotCloseWhileFnIsRunning(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var closed int32
+
+	closer := &safeCloser{fn: func() { atomic.AddInt32(&closed, 1) }}
+
+	go func() {
+		_, _ = runWithDeadline(closer, 10*time.Millisecond, func() ([]byte, error) {
+			close(started)
+			<-release
+			return nil, nil
+		})
+	}()
+
+	<-started
+	time.Sleep(30 * time.Millisecond) // let the deadline fire while fn is still blocked on release
+	if got := atomic.LoadInt32(&closed); got != 0 {
+		t.Fatalf("closer.Close ran while fn was still running (closed=%d), want 0", got)
+	}
+
+	close(release)
+	time.Sleep(10 * time.Millisecond) // give fn's goroutine a chance to return and close
+	if got := atomic.LoadInt32(&closed); got != 1 {
+		t.Fatalf("closer.Close ran %d times after fn returned, want exactly 1", got)
+	}
+}
+
+func TestRunWithDeadlineReturnsDeadlineExceededError(t *testing.T) {
+	closer := &safeCloser{fn: func() {}}
+	_, err := runWithDeadline(closer, 5*time.Millisecond, func() ([]byte, error) {
+		time.Sleep(50 * time.Millisecond)
+		return []byte("too late"), nil
+	})
+
+	if _, ok := err.(*DeadlineExceededError); !ok {
+		t.Fatalf("runWithDeadline returned %v, want a *DeadlineExceededError", err)
+	}
+}
+
+// TestExecuteContextRunsRealFixtureWithinBounds drives real bytecode through ExecuteContext's whole
+// pipeline — cache/compile/instantiate, gas metering, the memory page cap (before and after the call) and
+// runWithDeadline — rather than only the pure-Go pieces the other tests in this file isolate.
+func TestExecuteContextRunsRealFixtureWithinBounds(t *testing.T) {
+	code := loadFixtureModule(t)
+	params := []byte("hello fixture")
+
+	out, err := ExecuteWithOptions(code, params, nil, RunOptions{
+		GasLimit:         100_000,
+		MemoryLimitPages: 1,
+		Deadline:         time.Second,
+	})
+	if err != nil {
+		t.Fatalf("ExecuteWithOptions: %v", err)
+	}
+	if !bytes.Equal(out, params) {
+		t.Fatalf("ExecuteWithOptions = %q, want the fixture's __execute to echo back %q", out, params)
+	}
+}
+
+func TestPrepareContextRunsRealFixture(t *testing.T) {
+	code := loadFixtureModule(t)
+	params := []byte("prepare me")
+
+	out, err := PrepareWithOptions(code, params, RunOptions{
+		GasLimit:         100_000,
+		MemoryLimitPages: 1,
+		Deadline:         time.Second,
+	})
+	if err != nil {
+		t.Fatalf("PrepareWithOptions: %v", err)
+	}
+	if !bytes.Equal(out, params) {
+		t.Fatalf("PrepareWithOptions = %q, want the fixture's __prepare to echo back %q", out, params)
+	}
+}
@@ -0,0 +1,323 @@
+package wasm
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/crypto/sha3"
+
+	wasm "github.com/wasmerio/go-ext-wasm/wasmer"
+)
+
+// MemoryCtx gives a host callback access to the calling instance's linear memory and gas meter, using the
+// same pointer+length encoding allocateInner and parseOutput already use.
+type MemoryCtx struct {
+	instance wasm.Instance
+	meter    *gasMeter
+	Logs     []LogEvent
+
+	// err records the first error a host call hit while running for this instance (an out-of-range
+	// pointer/length, or the gas meter running dry). Wasm import functions can only return an int64, so
+	// this is how a callback reports a hard failure: it sets err and returns a sentinel, and
+	// ExecuteWithEnv surfaces err as the call's error once the export function returns instead of the
+	// script's own result.
+	err error
+}
+
+// ReadBytes returns the length bytes at ptr in the calling instance's linear memory, or an error if
+// ptr/length fall outside it. Every host callback that reads arguments out of wasm memory must go
+// through this instead of slicing instance.Memory.Data() directly: ptr and length come straight from the
+// wasm script's host-call arguments, so an out-of-range value here must not panic.
+func (m *MemoryCtx) ReadBytes(ptr, length int32) ([]byte, error) {
+	if ptr < 0 || length < 0 {
+		return nil, fmt.Errorf("ReadBytes: negative pointer (%d) or length (%d)", ptr, length)
+	}
+	mem := m.instance.Memory.Data()
+	end := int64(ptr) + int64(length)
+	if end > int64(len(mem)) {
+		return nil, fmt.Errorf("ReadBytes: range [%d:%d] outside %d-byte memory", ptr, end, len(mem))
+	}
+	return mem[ptr:end], nil
+}
+
+func (m *MemoryCtx) ReadString(ptr, length int32) (string, error) {
+	data, err := m.ReadBytes(ptr, length)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// WriteReply allocates room in the calling instance and copies data into it, returning the packed
+// pointer a wasm entrypoint would normally get back from parseOutput.
+func (m *MemoryCtx) WriteReply(data []byte) (int64, error) {
+	return allocateInner(m.instance, data)
+}
+
+func (m *MemoryCtx) ConsumeGas(amount uint64) error {
+	return m.meter.consume(amount)
+}
+
+// fail records err as the call's outcome and returns the sentinel host callbacks use to signal a hard
+// failure back to the (possibly well-behaved, possibly not) wasm script, without panicking.
+func (m *MemoryCtx) fail(err error) int64 {
+	if m.err == nil {
+		m.err = err
+	}
+	return -1
+}
+
+// LogEvent is a structured event a script emitted through the "log" host module. Execute callers get the
+// accumulated ring buffer back alongside the script's normal output.
+type LogEvent struct {
+	Message string
+	Fields  map[string]string
+}
+
+// HostFunc is a Go callback a wasm script can import. It receives the MemoryCtx bound to whichever
+// instance called it, plus the raw i64 arguments wasm passed.
+type HostFunc func(mem *MemoryCtx, args ...int64) int64
+
+// HostEnv registers Go callbacks as wasm imports before instantiation, namespaced the way Wasmer expects
+// ("namespace"."name"), so a script can call back into the chain for state or emit structured events.
+type HostEnv struct {
+	mu    sync.Mutex
+	funcs map[string]map[string]HostFunc
+	costs map[string]map[string]uint64
+}
+
+func NewHostEnv() *HostEnv {
+	return &HostEnv{
+		funcs: make(map[string]map[string]HostFunc),
+		costs: make(map[string]map[string]uint64),
+	}
+}
+
+// Register adds fn under namespace/name. cost is the gas deducted from the calling instance's meter
+// before fn runs, so a script can't make unbounded host calls for free.
+func (h *HostEnv) Register(namespace, name string, cost uint64, fn HostFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.funcs[namespace] == nil {
+		h.funcs[namespace] = make(map[string]HostFunc)
+		h.costs[namespace] = make(map[string]uint64)
+	}
+	h.funcs[namespace][name] = fn
+	h.costs[namespace][name] = cost
+}
+
+// newInstanceWithEnv compiles code through the module cache as usual, then instantiates it with env's
+// callbacks wired up as imports and meter backing every __consume_gas deduction, including the one each
+// host call makes before running.
+func newInstanceWithEnv(code []byte, env *HostEnv, meter *gasMeter) (wasm.Instance, *MemoryCtx, error) {
+	module, err := defaultCache.GetOrCompile(code)
+	if err != nil {
+		return wasm.Instance{}, nil, err
+	}
+
+	mem := &MemoryCtx{meter: meter}
+	imports := wasm.NewImports()
+	for namespace, fns := range env.funcs {
+		imports = imports.Namespace(namespace)
+		for name, fn := range fns {
+			cost, boundFn := env.costs[namespace][name], fn
+			imports, err = imports.AppendFunction(name, func(args ...int64) int64 {
+				if err := mem.ConsumeGas(cost); err != nil {
+					// Record and return a sentinel rather than panic: this runs inside a cgo
+					// callback from wasmer with no recover() in this package, so panicking here
+					// would crash the whole process instead of just failing this script's call.
+					return mem.fail(err)
+				}
+				return boundFn(mem, args...)
+			}, nil)
+			if err != nil {
+				return wasm.Instance{}, nil, err
+			}
+		}
+	}
+
+	instance, err := module.InstantiateWithImports(imports)
+	if err != nil {
+		return wasm.Instance{}, nil, err
+	}
+	mem.instance = instance
+	return instance, mem, nil
+}
+
+// ChainView is the read-only slice of chain state the "chain" host module exposes to scripts.
+type ChainView interface {
+	BlockHeight() uint64
+	ReadState(key string) (string, bool)
+}
+
+// RegisterChainModule adds the "chain" host module: get_block_height and read_state.
+func RegisterChainModule(env *HostEnv, chain ChainView) {
+	env.Register("chain", "get_block_height", 100, func(mem *MemoryCtx, args ...int64) int64 {
+		return int64(chain.BlockHeight())
+	})
+	env.Register("chain", "read_state", 500, func(mem *MemoryCtx, args ...int64) int64 {
+		key, err := mem.ReadString(int32(args[0]), int32(args[1]))
+		if err != nil {
+			return mem.fail(err)
+		}
+		value, ok := chain.ReadState(key)
+		if !ok {
+			return -1
+		}
+		loc, err := mem.WriteReply([]byte(value))
+		if err != nil {
+			return mem.fail(err)
+		}
+		return loc
+	})
+}
+
+// RegisterCryptoModule adds the "crypto" host module: keccak256, sha256 and ed25519_verify.
+func RegisterCryptoModule(env *HostEnv) {
+	env.Register("crypto", "sha256", 200, func(mem *MemoryCtx, args ...int64) int64 {
+		data, err := mem.ReadBytes(int32(args[0]), int32(args[1]))
+		if err != nil {
+			return mem.fail(err)
+		}
+		sum := sha256.Sum256(data)
+		loc, err := mem.WriteReply(sum[:])
+		if err != nil {
+			return mem.fail(err)
+		}
+		return loc
+	})
+	env.Register("crypto", "keccak256", 200, func(mem *MemoryCtx, args ...int64) int64 {
+		data, err := mem.ReadBytes(int32(args[0]), int32(args[1]))
+		if err != nil {
+			return mem.fail(err)
+		}
+		sum := sha3.NewLegacyKeccak256()
+		sum.Write(data)
+		loc, err := mem.WriteReply(sum.Sum(nil))
+		if err != nil {
+			return mem.fail(err)
+		}
+		return loc
+	})
+	env.Register("crypto", "ed25519_verify", 1000, func(mem *MemoryCtx, args ...int64) int64 {
+		pubKey, err := mem.ReadBytes(int32(args[0]), int32(args[1]))
+		if err != nil {
+			return mem.fail(err)
+		}
+		msg, err := mem.ReadBytes(int32(args[2]), int32(args[3]))
+		if err != nil {
+			return mem.fail(err)
+		}
+		sig, err := mem.ReadBytes(int32(args[4]), int32(args[5]))
+		if err != nil {
+			return mem.fail(err)
+		}
+		if ed25519.Verify(pubKey, msg, sig) {
+			return 1
+		}
+		return 0
+	})
+}
+
+// RegisterLogModule adds the "log" host module: emit appends a structured event to the calling
+// MemoryCtx's ring buffer, which is returned to the Execute/Prepare caller alongside the script output.
+func RegisterLogModule(env *HostEnv) {
+	env.Register("log", "emit", 50, func(mem *MemoryCtx, args ...int64) int64 {
+		msg, err := mem.ReadString(int32(args[0]), int32(args[1]))
+		if err != nil {
+			return mem.fail(err)
+		}
+		mem.Logs = append(mem.Logs, LogEvent{Message: msg})
+		return int64(len(mem.Logs))
+	})
+}
+
+// ExecuteWithEnv behaves like ExecuteWithOptions but instantiates the script with env's host callbacks
+// wired up as imports, and returns whatever structured events the script emitted through the "log"
+// module alongside its normal output.
+func ExecuteWithEnv(code []byte, params []byte, inputs [][]byte, opts RunOptions, env *HostEnv) ([]byte, []LogEvent, error) {
+	return ExecuteWithEnvContext(context.Background(), code, params, inputs, opts, env)
+}
+
+// ExecuteWithEnvContext is ExecuteWithEnv with a context.Context for cancellation and tracing. It bounds
+// gas, memory and the deadline identically to ExecuteContext and ExecuteMsgpackContext: a script gets no
+// weaker resource bounds just because it imports host functions.
+func ExecuteWithEnvContext(ctx context.Context, code []byte, params []byte, inputs [][]byte, opts RunOptions, env *HostEnv) ([]byte, []LogEvent, error) {
+	span, ctx := startSpan(ctx, "wasm.ExecuteWithEnv", code)
+	span.SetTag("wasm.params_size", len(params))
+	defer span.Finish()
+
+	meter := newGasMeter(opts.GasLimit)
+	instance, mem, err := newInstanceWithEnv(code, env, meter)
+	if err != nil {
+		finish(span, err)
+		return nil, nil, err
+	}
+	closer := newSafeCloser(instance)
+
+	out, err := runWithDeadline(closer, opts.Deadline, func() ([]byte, error) {
+		if err := meter.consume(uint64(len(params)) * gasPerByte); err != nil {
+			return nil, err
+		}
+		paramsInput, err := storeParams(instance, params)
+		if err != nil {
+			return nil, err
+		}
+
+		inputSize := 0
+		for _, each := range inputs {
+			inputSize += len(each)
+		}
+		if err := meter.consume(uint64(inputSize) * gasPerByte); err != nil {
+			return nil, err
+		}
+		wasmInput, err := allocate(instance, inputs)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := capMemoryPages(instance, opts.MemoryLimitPages); err != nil {
+			return nil, err
+		}
+
+		fn := instance.Exports["__execute"]
+		if fn == nil {
+			return nil, errors.New("__execute not implemented")
+		}
+		callSpan, _ := childSpan(ctx, "wasm.call.__execute")
+		ptr, err := fn(paramsInput, wasmInput)
+		finish(callSpan, err)
+		if err != nil {
+			return nil, err
+		}
+		if mem.err != nil {
+			// A host callback hit a hard failure (bad pointer, gas exhaustion, ...) but could only
+			// signal it through its int64 return value, not by returning early here — surface it now
+			// instead of treating whatever __execute returned as a successful result.
+			return nil, mem.err
+		}
+		if err := capMemoryPages(instance, opts.MemoryLimitPages); err != nil {
+			return nil, err
+		}
+
+		out, err := parseOutput(instance, ptr.ToI64())
+		if err != nil {
+			return nil, err
+		}
+		if err := meter.consume(uint64(len(out)) * gasPerByte); err != nil {
+			return nil, err
+		}
+		return out, nil
+	})
+
+	span.SetTag("wasm.gas_used", opts.GasLimit-meter.left)
+	if _, timedOut := err.(*DeadlineExceededError); !timedOut {
+		span.SetTag("wasm.memory_pages", uint32(instance.Memory.Length()))
+	}
+	finish(span, err)
+	return out, mem.Logs, err
+}
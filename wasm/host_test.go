@@ -0,0 +1,73 @@
+package wasm
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// TestMemoryCtxReadBytesRejectsNegativeArgs covers the bounds check that runs before ReadBytes ever
+// touches instance memory, so it doesn't need a real wasm.Instance to exercise.
+func TestMemoryCtxReadBytesRejectsNegativeArgs(t *testing.T) {
+	mem := &MemoryCtx{}
+
+	if _, err := mem.ReadBytes(-1, 4); err == nil {
+		t.Fatal("ReadBytes: expected an error for a negative pointer, got nil")
+	}
+	if _, err := mem.ReadBytes(0, -1); err == nil {
+		t.Fatal("ReadBytes: expected an error for a negative length, got nil")
+	}
+}
+
+func TestMemoryCtxFailRecordsFirstErrorOnly(t *testing.T) {
+	mem := &MemoryCtx{}
+	first := errFixture("first")
+	second := errFixture("second")
+
+	if got := mem.fail(first); got != -1 {
+		t.Fatalf("fail returned %d, want -1", got)
+	}
+	mem.fail(second)
+
+	if mem.err != first {
+		t.Fatalf("mem.err = %v, want the first error recorded (%v)", mem.err, first)
+	}
+}
+
+type errFixture string
+
+func (e errFixture) Error() string { return string(e) }
+
+// TestExecuteWithEnvRunsRealFixtureWithHostCallback drives real bytecode through newInstanceWithEnv and
+// ExecuteWithEnv, the one path no other test in this package exercises with an actual wasm.Instance: host
+// import wiring, InstantiateWithImports, and the gas/memory bounds ExecuteWithEnv now enforces around the
+// real __execute call.
+func TestExecuteWithEnvRunsRealFixtureWithHostCallback(t *testing.T) {
+	code := loadFixtureModule(t)
+	params := []byte("host env fixture")
+
+	env := NewHostEnv()
+	called := false
+	env.Register("log", "emit", 10, func(mem *MemoryCtx, args ...int64) int64 {
+		called = true // the fixture's __execute never calls an import, so this must stay false
+		return 0
+	})
+
+	out, logs, err := ExecuteWithEnv(code, params, nil, RunOptions{
+		GasLimit:         100_000,
+		MemoryLimitPages: 1,
+		Deadline:         time.Second,
+	}, env)
+	if err != nil {
+		t.Fatalf("ExecuteWithEnv: %v", err)
+	}
+	if !bytes.Equal(out, params) {
+		t.Fatalf("ExecuteWithEnv = %q, want the fixture's __execute to echo back %q", out, params)
+	}
+	if len(logs) != 0 {
+		t.Fatalf("ExecuteWithEnv returned %d log events, want 0", len(logs))
+	}
+	if called {
+		t.Fatal("registered host callback ran, but the fixture module never imports it")
+	}
+}
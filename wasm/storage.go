@@ -0,0 +1,270 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Info describes a single piece of stored bytecode.
+type Info struct {
+	ID   string
+	Size int64
+}
+
+// Storage loads and saves oracle script bytecode. Implementations live in this file for local disk and
+// in-memory backends; S3Storage adapts any S3/minio-compatible client that satisfies S3Client.
+type Storage interface {
+	Get(ctx context.Context, id string) ([]byte, error)
+	Put(ctx context.Context, id string, code []byte) error
+	Stat(ctx context.Context, id string) (Info, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// Lister is implemented by backends that can enumerate every id they hold; MigrateStorage needs it to
+// know what to copy.
+type Lister interface {
+	List(ctx context.Context) ([]string, error)
+}
+
+// SignedURLProvider is implemented by backends that can hand a client a direct URL to fetch a large
+// script from, instead of proxying the bytes through the host.
+type SignedURLProvider interface {
+	SignedURL(id string) (string, time.Duration, error)
+}
+
+// StorageConfig selects and configures a Storage backend so operators can switch without code changes.
+type StorageConfig struct {
+	Type      string // "local", "minio", "s3" or "memory"
+	Dir       string // local
+	Endpoint  string // minio/s3
+	Bucket    string // minio/s3
+	AccessKey string // minio/s3
+	SecretKey string // minio/s3
+	Region    string // s3
+	Insecure  bool   // minio/s3, skip TLS verification against the endpoint
+}
+
+// NewStorage builds a Storage backend from cfg. The minio/s3 types require an S3Client to be supplied
+// separately via NewS3Storage, since this package does not vendor an object-storage SDK.
+func NewStorage(cfg StorageConfig) (Storage, error) {
+	switch cfg.Type {
+	case "local":
+		return NewLocalStorage(cfg.Dir), nil
+	case "memory":
+		return NewMemoryStorage(), nil
+	case "minio", "s3":
+		return nil, fmt.Errorf("NewStorage: %s requires an S3Client, use NewS3Storage directly", cfg.Type)
+	default:
+		return nil, fmt.Errorf("NewStorage: unknown storage type %q", cfg.Type)
+	}
+}
+
+// LocalStorage stores bytecode as files under a root directory, one file per id.
+type LocalStorage struct {
+	dir string
+}
+
+func NewLocalStorage(dir string) *LocalStorage {
+	return &LocalStorage{dir: dir}
+}
+
+func (s *LocalStorage) path(id string) string {
+	return filepath.Join(s.dir, filepath.Base(id))
+}
+
+func (s *LocalStorage) Get(ctx context.Context, id string) ([]byte, error) {
+	return os.ReadFile(s.path(id))
+}
+
+func (s *LocalStorage) Put(ctx context.Context, id string, code []byte) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(s.path(id), code, 0o644)
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, id string) (Info, error) {
+	fi, err := os.Stat(s.path(id))
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{ID: id, Size: fi.Size()}, nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, id string) error {
+	return os.Remove(s.path(id))
+}
+
+func (s *LocalStorage) List(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			ids = append(ids, e.Name())
+		}
+	}
+	return ids, nil
+}
+
+// MemoryStorage keeps bytecode in a map and is meant for tests.
+type MemoryStorage struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{files: make(map[string][]byte)}
+}
+
+func (s *MemoryStorage) Get(ctx context.Context, id string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	code, ok := s.files[id]
+	if !ok {
+		return nil, fmt.Errorf("MemoryStorage: %q not found", id)
+	}
+	return code, nil
+}
+
+func (s *MemoryStorage) Put(ctx context.Context, id string, code []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[id] = append([]byte(nil), code...)
+	return nil
+}
+
+func (s *MemoryStorage) Stat(ctx context.Context, id string) (Info, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	code, ok := s.files[id]
+	if !ok {
+		return Info{}, fmt.Errorf("MemoryStorage: %q not found", id)
+	}
+	return Info{ID: id, Size: int64(len(code))}, nil
+}
+
+func (s *MemoryStorage) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.files[id]; !ok {
+		return fmt.Errorf("MemoryStorage: %q not found", id)
+	}
+	delete(s.files, id)
+	return nil
+}
+
+func (s *MemoryStorage) List(ctx context.Context) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]string, 0, len(s.files))
+	for id := range s.files {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// S3Client is the minimal surface S3Storage needs from an S3/minio SDK client, so this package doesn't
+// have to vendor one; any real client (aws-sdk-go, minio-go) can be adapted to it.
+type S3Client interface {
+	GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+	PutObject(ctx context.Context, bucket, key string, body []byte) error
+	HeadObject(ctx context.Context, bucket, key string) (int64, error)
+	DeleteObject(ctx context.Context, bucket, key string) error
+	PresignGetObject(ctx context.Context, bucket, key string, expires time.Duration) (string, error)
+}
+
+// S3Storage adapts an S3Client plus a bucket name to the Storage interface, for S3 and minio-compatible
+// object storage.
+type S3Storage struct {
+	client S3Client
+	bucket string
+}
+
+func NewS3Storage(client S3Client, bucket string) *S3Storage {
+	return &S3Storage{client: client, bucket: bucket}
+}
+
+func (s *S3Storage) Get(ctx context.Context, id string) ([]byte, error) {
+	r, err := s.client.GetObject(ctx, s.bucket, id)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func (s *S3Storage) Put(ctx context.Context, id string, code []byte) error {
+	return s.client.PutObject(ctx, s.bucket, id, code)
+}
+
+func (s *S3Storage) Stat(ctx context.Context, id string) (Info, error) {
+	size, err := s.client.HeadObject(ctx, s.bucket, id)
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{ID: id, Size: size}, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, id string) error {
+	return s.client.DeleteObject(ctx, s.bucket, id)
+}
+
+func (s *S3Storage) SignedURL(id string) (string, time.Duration, error) {
+	const expires = 15 * time.Minute
+	url, err := s.client.PresignGetObject(context.Background(), s.bucket, id, expires)
+	return url, expires, err
+}
+
+// MigrateStorage copies every script from to, requiring from to implement Lister so the set of ids to
+// copy is known.
+func MigrateStorage(ctx context.Context, from, to Storage) error {
+	lister, ok := from.(Lister)
+	if !ok {
+		return errors.New("MigrateStorage: source storage cannot list its ids")
+	}
+	ids, err := lister.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		code, err := from.Get(ctx, id)
+		if err != nil {
+			return fmt.Errorf("MigrateStorage: get %q: %w", id, err)
+		}
+		if err := to.Put(ctx, id, code); err != nil {
+			return fmt.Errorf("MigrateStorage: put %q: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// ExecuteFromStorage fetches code for id from store, through the module cache, and executes it without
+// the caller ever holding the raw bytecode itself.
+func ExecuteFromStorage(ctx context.Context, store Storage, id string, params []byte, inputs [][]byte) ([]byte, error) {
+	code, err := store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return ExecuteContext(ctx, code, params, inputs, DefaultRunOptions)
+}
+
+// PrepareFromStorage is PrepareWithOptions's counterpart to ExecuteFromStorage.
+func PrepareFromStorage(ctx context.Context, store Storage, id string, params []byte) ([]byte, error) {
+	code, err := store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return PrepareContext(ctx, code, params, DefaultRunOptions)
+}
@@ -0,0 +1,91 @@
+package wasm
+
+import (
+	"context"
+
+	wasm "github.com/wasmerio/go-ext-wasm/wasmer"
+)
+
+// Span is the minimal surface this package needs from a tracing span, so callers can plug in
+// opentracing, ddtrace, or anything else that can satisfy it.
+type Span interface {
+	SetTag(key string, value interface{})
+	Finish()
+}
+
+// Tracer starts spans for wasm entrypoints. The zero value of this package uses a no-op tracer, so
+// tracing is free until Configure(WithTracer(...)) is called.
+type Tracer interface {
+	StartSpan(ctx context.Context, operation string) (Span, context.Context)
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetTag(string, interface{}) {}
+func (noopSpan) Finish()                    {}
+
+type noopTracer struct{}
+
+func (noopTracer) StartSpan(ctx context.Context, operation string) (Span, context.Context) {
+	return noopSpan{}, ctx
+}
+
+var (
+	activeTracer Tracer  = noopTracer{}
+	serviceName  string  = "wasm"
+	sampleRate   float64 = 1
+)
+
+// Option configures package-wide tracing behavior; see Configure.
+type Option func()
+
+// WithTracer sets the Tracer every wasm entrypoint reports spans to.
+func WithTracer(t Tracer) Option {
+	return func() { activeTracer = t }
+}
+
+// WithServiceName sets the service.name tag attached to every span.
+func WithServiceName(name string) Option {
+	return func() { serviceName = name }
+}
+
+// WithSampleRate sets the fraction of calls a real Tracer is expected to sample; it is advisory and
+// tracers that don't support sampling may ignore it.
+func WithSampleRate(rate float64) Option {
+	return func() { sampleRate = rate }
+}
+
+// Configure applies tracing options; call it once during process startup.
+func Configure(opts ...Option) {
+	for _, opt := range opts {
+		opt()
+	}
+}
+
+func startSpan(ctx context.Context, operation string, code []byte) (Span, context.Context) {
+	span, ctx := activeTracer.StartSpan(ctx, operation)
+	span.SetTag("service.name", serviceName)
+	span.SetTag("wasm.code_size", len(code))
+	return span, ctx
+}
+
+func childSpan(ctx context.Context, operation string) (Span, context.Context) {
+	return activeTracer.StartSpan(ctx, operation)
+}
+
+func finish(span Span, err error) {
+	if err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.message", err.Error())
+	}
+	span.Finish()
+}
+
+// newInstanceTraced wraps newInstance with a child span covering compilation, which ModuleCache may have
+// already amortised away.
+func newInstanceTraced(ctx context.Context, code []byte) (wasm.Instance, error) {
+	span, _ := childSpan(ctx, "wasm.compile")
+	instance, err := newInstance(code)
+	finish(span, err)
+	return instance, err
+}
@@ -0,0 +1,83 @@
+package wasm
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSpan captures the tags a real call sets on it, so a test can assert on what ExecuteContext
+// actually reported instead of just that it didn't error.
+type recordingSpan struct {
+	mu   sync.Mutex
+	tags map[string]interface{}
+}
+
+func (s *recordingSpan) SetTag(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tags == nil {
+		s.tags = make(map[string]interface{})
+	}
+	s.tags[key] = value
+}
+
+func (s *recordingSpan) Finish() {}
+
+func (s *recordingSpan) tag(key string) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.tags[key]
+	return v, ok
+}
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+func (rt *recordingTracer) StartSpan(ctx context.Context, operation string) (Span, context.Context) {
+	span := &recordingSpan{}
+	rt.mu.Lock()
+	rt.spans = append(rt.spans, span)
+	rt.mu.Unlock()
+	return span, ctx
+}
+
+// TestExecuteContextRecordsMemoryPagesAfterARealRun guards the chunk0-6 fix from the other direction:
+// skipping the post-deadline Memory.Length() read must not turn into skipping it on the ordinary,
+// succeeded-in-time path too. It runs the real fixture module end to end and checks the tag is actually
+// there.
+func TestExecuteContextRecordsMemoryPagesAfterARealRun(t *testing.T) {
+	tracer := &recordingTracer{}
+	Configure(WithTracer(tracer))
+	t.Cleanup(func() { Configure(WithTracer(noopTracer{})) })
+
+	code := loadFixtureModule(t)
+	if _, err := ExecuteWithOptions(code, []byte("trace me"), nil, RunOptions{
+		GasLimit:         100_000,
+		MemoryLimitPages: 1,
+		Deadline:         time.Second,
+	}); err != nil {
+		t.Fatalf("ExecuteWithOptions: %v", err)
+	}
+
+	tracer.mu.Lock()
+	spans := append([]*recordingSpan(nil), tracer.spans...)
+	tracer.mu.Unlock()
+
+	var root *recordingSpan
+	for _, span := range spans {
+		if _, ok := span.tag("wasm.memory_pages"); ok {
+			root = span
+			break
+		}
+	}
+	if root == nil {
+		t.Fatal("no span recorded a wasm.memory_pages tag for a run that completed before its deadline")
+	}
+	if pages, _ := root.tag("wasm.memory_pages"); pages != uint32(1) {
+		t.Fatalf("wasm.memory_pages = %v, want 1 (the fixture module never grows its memory)", pages)
+	}
+}
@@ -1,6 +1,7 @@
 package wasm
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"unicode"
@@ -62,152 +63,248 @@ func storeParams(instance wasm.Instance, params []byte) (int64, error) {
 }
 
 func Name(code []byte) (string, error) {
-	instance, err := wasm.NewInstance(code)
+	return NameContext(context.Background(), code)
+}
+
+func NameContext(ctx context.Context, code []byte) (string, error) {
+	span, ctx := startSpan(ctx, "wasm.Name", code)
+	defer span.Finish()
+
+	instance, err := newInstanceTraced(ctx, code)
 	if err != nil {
+		finish(span, err)
 		return "", err
 	}
 	defer instance.Close()
 	fn := instance.Exports["__name"]
 	if fn == nil {
-		return "", errors.New("__name not implemented")
+		err := errors.New("__name not implemented")
+		finish(span, err)
+		return "", err
 	}
+
+	callSpan, _ := childSpan(ctx, "wasm.call.__name")
 	ptr, err := fn()
+	finish(callSpan, err)
 	if err != nil {
+		finish(span, err)
 		return "", err
 	}
+
+	unmarshalSpan, _ := childSpan(ctx, "wasm.unmarshal")
 	rawResult, err := parseOutput(instance, ptr.ToI64())
+	finish(unmarshalSpan, err)
 	if err != nil {
+		finish(span, err)
 		return "", err
 	}
+	if _, ok := abiVersion(instance); ok {
+		jsonResult, err := msgpackToJSON(rawResult)
+		if err != nil {
+			finish(span, err)
+			return "", err
+		}
+		rawResult = jsonResult
+	}
 	for _, ch := range string(rawResult) {
 		if !unicode.IsPrint(ch) {
-			return "", errors.New("Invalid name character")
+			err := errors.New("Invalid name character")
+			finish(span, err)
+			return "", err
 		}
 	}
+	span.SetTag("wasm.name", string(rawResult))
+	span.Finish()
 	return string(rawResult), nil
 }
 
 func ParamsInfo(code []byte) ([]byte, error) {
-	instance, err := wasm.NewInstance(code)
+	return ParamsInfoContext(context.Background(), code)
+}
+
+func ParamsInfoContext(ctx context.Context, code []byte) ([]byte, error) {
+	span, ctx := startSpan(ctx, "wasm.ParamsInfo", code)
+	defer span.Finish()
+
+	instance, err := newInstanceTraced(ctx, code)
 	if err != nil {
+		finish(span, err)
 		return nil, err
 	}
 	defer instance.Close()
 	fn := instance.Exports["__params_info"]
 	if fn == nil {
-		return nil, errors.New("__params_info not implemented")
+		err := errors.New("__params_info not implemented")
+		finish(span, err)
+		return nil, err
 	}
+
+	callSpan, _ := childSpan(ctx, "wasm.call.__params_info")
 	ptr, err := fn()
+	finish(callSpan, err)
+	if err != nil {
+		finish(span, err)
+		return nil, err
+	}
+
+	unmarshalSpan, _ := childSpan(ctx, "wasm.unmarshal")
+	rawResult, err := parseOutput(instance, ptr.ToI64())
+	finish(unmarshalSpan, err)
 	if err != nil {
+		finish(span, err)
 		return nil, err
 	}
-	return parseOutput(instance, ptr.ToI64())
+	if _, ok := abiVersion(instance); ok {
+		rawResult, err = msgpackToJSON(rawResult)
+		finish(span, err)
+		return rawResult, err
+	}
+	return rawResult, nil
 }
 
 func ParseParams(code []byte, params []byte) ([]byte, error) {
-	instance, err := wasm.NewInstance(code)
+	return ParseParamsContext(context.Background(), code, params)
+}
+
+func ParseParamsContext(ctx context.Context, code []byte, params []byte) ([]byte, error) {
+	span, ctx := startSpan(ctx, "wasm.ParseParams", code)
+	span.SetTag("wasm.params_size", len(params))
+	defer span.Finish()
+
+	instance, err := newInstanceTraced(ctx, code)
 	if err != nil {
+		finish(span, err)
 		return nil, err
 	}
 	defer instance.Close()
+
+	marshalSpan, _ := childSpan(ctx, "wasm.marshal")
 	paramsInput, err := storeParams(instance, params)
+	finish(marshalSpan, err)
 	if err != nil {
+		finish(span, err)
 		return nil, err
 	}
+
 	fn := instance.Exports["__parse_params"]
 	if fn == nil {
-		return nil, errors.New("__parse_params not implemented")
+		err := errors.New("__parse_params not implemented")
+		finish(span, err)
+		return nil, err
 	}
+
+	callSpan, _ := childSpan(ctx, "wasm.call.__parse_params")
 	ptr, err := fn(paramsInput)
+	finish(callSpan, err)
 	if err != nil {
+		finish(span, err)
 		return nil, err
 	}
-	return parseOutput(instance, ptr.ToI64())
+
+	unmarshalSpan, _ := childSpan(ctx, "wasm.unmarshal")
+	rawResult, err := parseOutput(instance, ptr.ToI64())
+	finish(unmarshalSpan, err)
+	finish(span, err)
+	return rawResult, err
 }
 
 func RawDataInfo(code []byte) ([]byte, error) {
-	instance, err := wasm.NewInstance(code)
+	return RawDataInfoContext(context.Background(), code)
+}
+
+func RawDataInfoContext(ctx context.Context, code []byte) ([]byte, error) {
+	span, ctx := startSpan(ctx, "wasm.RawDataInfo", code)
+	defer span.Finish()
+
+	instance, err := newInstanceTraced(ctx, code)
 	if err != nil {
+		finish(span, err)
 		return nil, err
 	}
 	defer instance.Close()
 	fn := instance.Exports["__raw_data_info"]
 	if fn == nil {
-		return nil, errors.New("__raw_data_info not implemented")
+		err := errors.New("__raw_data_info not implemented")
+		finish(span, err)
+		return nil, err
 	}
+
+	callSpan, _ := childSpan(ctx, "wasm.call.__raw_data_info")
 	ptr, err := fn()
+	finish(callSpan, err)
+	if err != nil {
+		finish(span, err)
+		return nil, err
+	}
+
+	unmarshalSpan, _ := childSpan(ctx, "wasm.unmarshal")
+	rawResult, err := parseOutput(instance, ptr.ToI64())
+	finish(unmarshalSpan, err)
 	if err != nil {
+		finish(span, err)
 		return nil, err
 	}
-	return parseOutput(instance, ptr.ToI64())
+	if _, ok := abiVersion(instance); ok {
+		rawResult, err = msgpackToJSON(rawResult)
+		finish(span, err)
+		return rawResult, err
+	}
+	return rawResult, nil
 }
 
 func ParseRawData(code []byte, params []byte, data []byte) ([]byte, error) {
-	instance, err := wasm.NewInstance(code)
+	return ParseRawDataContext(context.Background(), code, params, data)
+}
+
+func ParseRawDataContext(ctx context.Context, code []byte, params []byte, data []byte) ([]byte, error) {
+	span, ctx := startSpan(ctx, "wasm.ParseRawData", code)
+	span.SetTag("wasm.params_size", len(params))
+	defer span.Finish()
+
+	instance, err := newInstanceTraced(ctx, code)
 	if err != nil {
+		finish(span, err)
 		return nil, err
 	}
 	defer instance.Close()
+
+	marshalSpan, _ := childSpan(ctx, "wasm.marshal")
 	paramsInput, err := storeParams(instance, params)
 	dataInput, err := allocateInner(instance, data)
+	finish(marshalSpan, err)
 	if err != nil {
+		finish(span, err)
 		return nil, err
 	}
+
 	fn := instance.Exports["__parse_raw_data"]
 	if fn == nil {
-		return nil, errors.New("__parse_raw_data not implemented")
+		err := errors.New("__parse_raw_data not implemented")
+		finish(span, err)
+		return nil, err
 	}
+
+	callSpan, _ := childSpan(ctx, "wasm.call.__parse_raw_data")
 	ptr, err := fn(paramsInput, dataInput)
+	finish(callSpan, err)
 	if err != nil {
+		finish(span, err)
 		return nil, err
 	}
-	return parseOutput(instance, ptr.ToI64())
+
+	unmarshalSpan, _ := childSpan(ctx, "wasm.unmarshal")
+	rawResult, err := parseOutput(instance, ptr.ToI64())
+	finish(unmarshalSpan, err)
+	finish(span, err)
+	return rawResult, err
 }
 
 func Prepare(code []byte, params []byte) ([]byte, error) {
-	instance, err := wasm.NewInstance(code)
-	if err != nil {
-		return nil, err
-	}
-	defer instance.Close()
-	paramsInput, err := storeParams(instance, params)
-	if err != nil {
-		return nil, err
-	}
-	fn := instance.Exports["__prepare"]
-	if fn == nil {
-		return nil, errors.New("__prepare not implemented")
-	}
-	ptr, err := fn(paramsInput)
-	if err != nil {
-		return nil, err
-	}
-	return parseOutput(instance, ptr.ToI64())
+	return PrepareWithOptions(code, params, DefaultRunOptions)
 }
 
 func Execute(code []byte, params []byte, inputs [][]byte) ([]byte, error) {
-	instance, err := wasm.NewInstance(code)
-	if err != nil {
-		return nil, err
-	}
-	defer instance.Close()
-	paramsInput, err := storeParams(instance, params)
-	if err != nil {
-		return nil, err
-	}
-	wasmInput, err := allocate(instance, inputs)
-	if err != nil {
-		return nil, err
-	}
-	fn := instance.Exports["__execute"]
-	if fn == nil {
-		return nil, errors.New("__execute not implemented")
-	}
-	ptr, err := fn(paramsInput, wasmInput)
-	if err != nil {
-		return nil, err
-	}
-	return parseOutput(instance, ptr.ToI64())
+	return ExecuteWithOptions(code, params, inputs, DefaultRunOptions)
 }
 
 func ReadBytes(filename string) ([]byte, error) {